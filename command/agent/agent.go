@@ -0,0 +1,112 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: BUSL-1.1
+
+package agent
+
+import (
+	log "github.com/hashicorp/go-hclog"
+)
+
+// Agent wraps the retry-join setup and bookkeeping shared by a Nomad server
+// or client.
+type Agent struct {
+	config *Config
+	logger log.Logger
+
+	// serverJoiner handles the primary retry_join for a server's LAN Serf
+	// pool, or the retry_join used by a client to discover servers.
+	serverJoiner *retryJoiner
+
+	// wanJoiner handles retry_join_wan for server-to-server region
+	// federation, or nil if this agent isn't a server, or no WAN join
+	// configuration (or federation_via_gateways) is set.
+	wanJoiner *retryJoiner
+
+	// shutdownCh is closed by a retryJoiner when it exhausts its retries,
+	// signaling the agent to shut down.
+	shutdownCh chan struct{}
+}
+
+// NewAgent constructs an Agent for the given configuration. Call Setup to
+// validate the configuration and wire up the retry joiners before starting
+// them.
+func NewAgent(config *Config, logger log.Logger) *Agent {
+	return &Agent{
+		config:     config,
+		logger:     logger,
+		shutdownCh: make(chan struct{}),
+	}
+}
+
+// Setup validates the agent's join configuration - folding any deprecated
+// start_join/retry_join settings into server_join along the way - and wires
+// the retry joiners that RetryJoinAll will start. serverJoinFunc and
+// wanJoinFunc perform the actual join once addresses have been resolved
+// (e.g. the server's Serf LAN/WAN Join, or the client's SetServers); either
+// may be nil if this agent doesn't run in that mode.
+func (a *Agent) Setup(serverJoinFunc, wanJoinFunc func([]string) (int, error)) error {
+	discoverer, err := newDiscover()
+	if err != nil {
+		return err
+	}
+	autoDiscover := &autoDiscover{netAddrs: &netAddrs{}, goDiscover: discoverer}
+
+	validator := &retryJoiner{logger: a.logger, errCh: a.shutdownCh}
+	if err := validator.Validate(a.config); err != nil {
+		return err
+	}
+
+	switch {
+	case a.config.Server != nil && a.config.Server.ServerJoin != nil:
+		sj := a.config.Server.ServerJoin
+
+		// LAN and WAN join are independent: a server may be configured
+		// with only retry_join, only retry_join_wan, or both, so each
+		// joiner is constructed based on its own address list rather than
+		// nesting one inside the other's guard.
+		if len(sj.RetryJoin) != 0 {
+			a.serverJoiner = &retryJoiner{
+				autoDiscover: autoDiscover,
+				errCh:        a.shutdownCh,
+				joinCfg:      sj,
+				joinFunc:     serverJoinFunc,
+				logger:       a.logger.Named("server_join"),
+			}
+		}
+
+		if len(sj.RetryJoinWAN) != 0 {
+			wanCfg := *sj
+			wanCfg.RetryJoin = sj.RetryJoinWAN
+			a.wanJoiner = &retryJoiner{
+				autoDiscover: autoDiscover,
+				errCh:        a.shutdownCh,
+				joinCfg:      &wanCfg,
+				joinFunc:     wanJoinFunc,
+				logger:       a.logger.Named("server_join.wan"),
+				viaGateways:  sj.FederationViaGateways,
+			}
+		}
+
+	case a.config.Client != nil && a.config.Client.ServerJoin != nil && len(a.config.Client.ServerJoin.RetryJoin) != 0:
+		a.serverJoiner = &retryJoiner{
+			autoDiscover: autoDiscover,
+			errCh:        a.shutdownCh,
+			joinCfg:      a.config.Client.ServerJoin,
+			joinFunc:     serverJoinFunc,
+			logger:       a.logger.Named("server_join"),
+		}
+	}
+
+	return nil
+}
+
+// RetryJoinAll starts the configured retry joiners in the background. It is
+// a no-op for any joiner that Setup did not configure.
+func (a *Agent) RetryJoinAll() {
+	if a.serverJoiner != nil {
+		go a.serverJoiner.RetryJoin()
+	}
+	if a.wanJoiner != nil {
+		go a.wanJoiner.RetryJoin()
+	}
+}
@@ -0,0 +1,155 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: BUSL-1.1
+
+package agent
+
+import (
+	"testing"
+
+	log "github.com/hashicorp/go-hclog"
+)
+
+func testAgent(t *testing.T, config *Config) *Agent {
+	t.Helper()
+	return NewAgent(config, log.NewNullLogger())
+}
+
+func TestAgent_Setup_ServerRetryJoinOnly(t *testing.T) {
+	a := testAgent(t, &Config{
+		Server: &ServerConfig{ServerJoin: &ServerJoin{RetryJoin: []string{"1.1.1.1"}}},
+	})
+
+	if err := a.Setup(nil, nil); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if a.serverJoiner == nil {
+		t.Fatal("expected serverJoiner to be built")
+	}
+	if a.wanJoiner != nil {
+		t.Fatal("expected wanJoiner to stay nil with no retry_join_wan")
+	}
+}
+
+func TestAgent_Setup_ServerRetryJoinWANOnly(t *testing.T) {
+	a := testAgent(t, &Config{
+		Server: &ServerConfig{ServerJoin: &ServerJoin{RetryJoinWAN: []string{"2.2.2.2"}}},
+	})
+
+	if err := a.Setup(nil, nil); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if a.serverJoiner != nil {
+		t.Fatal("expected serverJoiner to stay nil with no retry_join")
+	}
+	if a.wanJoiner == nil {
+		t.Fatal("expected wanJoiner to be built from retry_join_wan alone")
+	}
+	if a.wanJoiner.viaGateways {
+		t.Fatal("expected viaGateways to be false when federation_via_gateways is unset")
+	}
+}
+
+func TestAgent_Setup_ServerBothRetryJoinAndWAN(t *testing.T) {
+	a := testAgent(t, &Config{
+		Server: &ServerConfig{ServerJoin: &ServerJoin{
+			RetryJoin:    []string{"1.1.1.1"},
+			RetryJoinWAN: []string{"2.2.2.2"},
+		}},
+	})
+
+	if err := a.Setup(nil, nil); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if a.serverJoiner == nil {
+		t.Fatal("expected serverJoiner to be built")
+	}
+	if a.wanJoiner == nil {
+		t.Fatal("expected wanJoiner to be built")
+	}
+}
+
+func TestAgent_Setup_ServerJoinConfiguredWithNeitherList(t *testing.T) {
+	a := testAgent(t, &Config{
+		Server: &ServerConfig{ServerJoin: &ServerJoin{}},
+	})
+
+	if err := a.Setup(nil, nil); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if a.serverJoiner != nil {
+		t.Fatal("expected serverJoiner to stay nil")
+	}
+	if a.wanJoiner != nil {
+		t.Fatal("expected wanJoiner to stay nil")
+	}
+}
+
+func TestAgent_Setup_ClientRetryJoin(t *testing.T) {
+	a := testAgent(t, &Config{
+		Client: &ClientConfig{ServerJoin: &ServerJoin{RetryJoin: []string{"1.1.1.1"}}},
+	})
+
+	if err := a.Setup(nil, nil); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if a.serverJoiner == nil {
+		t.Fatal("expected serverJoiner to be built for a client's retry_join")
+	}
+	if a.wanJoiner != nil {
+		t.Fatal("clients never get a wanJoiner")
+	}
+}
+
+func TestAgent_Setup_ClientWithoutRetryJoin(t *testing.T) {
+	a := testAgent(t, &Config{
+		Client: &ClientConfig{ServerJoin: &ServerJoin{}},
+	})
+
+	if err := a.Setup(nil, nil); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if a.serverJoiner != nil {
+		t.Fatal("expected serverJoiner to stay nil without retry_join")
+	}
+}
+
+func TestAgent_Setup_NoJoinConfigured(t *testing.T) {
+	a := testAgent(t, &Config{})
+
+	if err := a.Setup(nil, nil); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if a.serverJoiner != nil || a.wanJoiner != nil {
+		t.Fatal("expected no joiners without any server or client config")
+	}
+}
+
+func TestAgent_Setup_RejectsFederationViaGateways(t *testing.T) {
+	a := testAgent(t, &Config{
+		Server: &ServerConfig{ServerJoin: &ServerJoin{
+			RetryJoinWAN:           []string{"2.2.2.2"},
+			FederationViaGateways: true,
+		}},
+	})
+
+	err := a.Setup(nil, nil)
+	if err == nil {
+		t.Fatal("expected Setup to surface Validate's federation_via_gateways rejection")
+	}
+	if a.serverJoiner != nil || a.wanJoiner != nil {
+		t.Fatal("expected no joiners to be built when Setup fails validation")
+	}
+}
+
+func TestAgent_Setup_FoldsDeprecatedServerAliases(t *testing.T) {
+	a := testAgent(t, &Config{
+		Server: &ServerConfig{RetryJoin: []string{"1.1.1.1"}},
+	})
+
+	if err := a.Setup(nil, nil); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if a.serverJoiner == nil {
+		t.Fatal("expected the deprecated top-level retry_join to be folded into server_join and joined on")
+	}
+}
@@ -0,0 +1,106 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: BUSL-1.1
+
+package agent
+
+import "time"
+
+// Config is the configuration for the Nomad agent, covering the subset of
+// the server and client join settings that retryJoiner and Agent.Setup
+// operate on.
+type Config struct {
+	// Server is the server-specific configuration, or nil if this agent is
+	// not running in server mode.
+	Server *ServerConfig
+
+	// Client is the client-specific configuration, or nil if this agent is
+	// not running in client mode.
+	Client *ClientConfig
+}
+
+// ServerConfig is the configuration for a Nomad server.
+type ServerConfig struct {
+	// ServerJoin is the server_join block used to auto-join a cluster.
+	ServerJoin *ServerJoin
+
+	// RetryJoin, StartJoin, RetryMaxAttempts, and RetryInterval are the
+	// deprecated top-level aliases of the equivalent server_join fields.
+	// They are folded into ServerJoin by retryJoiner.Validate rather than
+	// read directly.
+	RetryJoin        []string
+	StartJoin        []string
+	RetryMaxAttempts int
+	RetryInterval    time.Duration
+
+	// StartJoinWAN and RetryJoinWAN are the deprecated top-level aliases of
+	// ServerJoin.RetryJoinWAN.
+	StartJoinWAN []string
+	RetryJoinWAN []string
+}
+
+// ClientConfig is the configuration for a Nomad client.
+type ClientConfig struct {
+	// ServerJoin is the server_join block used to discover the servers a
+	// client should register with.
+	ServerJoin *ServerJoin
+}
+
+// ServerJoin is the server_join configuration block, shared by servers
+// (joining other servers, and federating with other regions) and clients
+// (discovering servers to register with).
+type ServerJoin struct {
+	// RetryJoin is the list of addresses, exec= commands, or go-discover
+	// provider configuration strings used to discover servers to join.
+	RetryJoin []string
+
+	// StartJoin is the deprecated alias of RetryJoin. On a server,
+	// retryJoiner.Validate folds it into RetryJoin when RetryJoin is unset,
+	// so its addresses are retried like RetryJoin's; on a client, it is
+	// rejected.
+	StartJoin []string
+
+	// RetryMaxAttempts is the maximum number of retries after the first
+	// failed join attempt before giving up. Zero means retry forever.
+	RetryMaxAttempts int
+
+	// RetryInterval is the fixed interval between join attempts, used when
+	// RetryBackoff is not configured.
+	RetryInterval time.Duration
+
+	// RetryJoinWAN is the list of addresses, exec= commands, or go-discover
+	// provider configuration strings used by a server to federate with
+	// another region's servers over the WAN pool.
+	RetryJoinWAN []string
+
+	// FederationViaGateways marks RetryJoinWAN as naming per-region mesh
+	// gateway addresses rather than remote region servers. Joins are not
+	// routed through gateways: retryJoiner.Validate rejects any server
+	// configuration that sets it, and the WAN joiner otherwise only uses it
+	// to choose its log message.
+	FederationViaGateways bool
+
+	// RetryBackoff configures exponential backoff with jitter between
+	// retry-join attempts. If nil, RetryInterval is used as a fixed sleep.
+	RetryBackoff *RetryBackoff
+}
+
+// RetryBackoff configures exponential backoff with decorrelated jitter between
+// retry-join attempts, along the lines of AWS's decorrelated-jitter
+// algorithm, plus a TTL for caching successful discovery results.
+type RetryBackoff struct {
+	// InitialInterval is the backoff floor: the shortest possible sleep
+	// between attempts.
+	InitialInterval time.Duration
+
+	// MaxInterval is the backoff ceiling.
+	MaxInterval time.Duration
+
+	// Multiplier scales the previous sleep to compute the next backoff
+	// ceiling. Defaults to 3 (matching AWS's decorrelated jitter) when
+	// unset.
+	Multiplier float64
+
+	// CacheTTL is how long a successful discovery result is reused before
+	// retryJoiner rediscovers addresses for a given retry_join entry.
+	CacheTTL time.Duration
+}
@@ -0,0 +1,187 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: BUSL-1.1
+
+// Package discover implements a go-discover provider that resolves Nomad
+// server addresses from a managed, hosted control-plane endpoint, analogous
+// to Consul's agent/hcp/discover provider.
+package discover
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"sync"
+	"time"
+)
+
+// defaultCacheTTL is how long a successful lookup is cached before the
+// provider will contact the endpoint again.
+const defaultCacheTTL = 30 * time.Second
+
+// defaultTimeout bounds how long a single lookup request is allowed to take.
+const defaultTimeout = 10 * time.Second
+
+// entry is a single address returned by the hosted control-plane endpoint.
+type entry struct {
+	Address string `json:"address"`
+	Port    int    `json:"port"`
+}
+
+// Provider implements the go-discover.Provider interface for Nomad's
+// HCP-style hosted discovery. It resolves a `cluster` identifier to the
+// current set of Nomad server addresses via a configurable REST endpoint,
+// caching the result for a TTL to avoid hammering the endpoint on every
+// retry-join attempt.
+type Provider struct {
+	// httpClient is used to perform the lookup request. It is overridable so
+	// tests can inject a fake transport.
+	httpClient *http.Client
+
+	mu       sync.Mutex
+	cacheKey string
+	cacheAt  time.Time
+	cached   []string
+}
+
+// Help describes the format of the provider's configuration string, shown as
+// part of `nomad agent -help`.
+func (p *Provider) Help() string {
+	return `Nomad HCP-style hosted discovery
+
+    provider:          "hcp"
+    cluster:           The cluster identifier to resolve addresses for.
+    endpoint:          The REST endpoint to query. Defaults to the value of
+                        the NOMAD_HCP_DISCOVER_ENDPOINT environment variable.
+    client_id:         Credential used to authenticate to the endpoint.
+                        Defaults to the value of the NOMAD_HCP_CLIENT_ID
+                        environment variable.
+    client_secret:     Credential used to authenticate to the endpoint.
+                        Defaults to the value of the NOMAD_HCP_CLIENT_SECRET
+                        environment variable.
+`
+}
+
+// Addrs resolves the `cluster` named in args to a list of "ip:port" strings
+// by querying the configured REST endpoint. The result for the most recently
+// looked-up cluster is cached for defaultCacheTTL; a lookup for a different
+// cluster replaces it.
+func (p *Provider) Addrs(args map[string]string, l *log.Logger) ([]string, error) {
+	cluster := args["cluster"]
+	if cluster == "" {
+		return nil, fmt.Errorf("discover-hcp: 'cluster' must be set")
+	}
+
+	endpoint := args["endpoint"]
+	if endpoint == "" {
+		endpoint = os.Getenv("NOMAD_HCP_DISCOVER_ENDPOINT")
+	}
+	if endpoint == "" {
+		return nil, fmt.Errorf("discover-hcp: 'endpoint' must be set, or NOMAD_HCP_DISCOVER_ENDPOINT must be set")
+	}
+
+	clientID := args["client_id"]
+	if clientID == "" {
+		clientID = os.Getenv("NOMAD_HCP_CLIENT_ID")
+	}
+	clientSecret := args["client_secret"]
+	if clientSecret == "" {
+		clientSecret = os.Getenv("NOMAD_HCP_CLIENT_SECRET")
+	}
+
+	if addrs, ok := p.fromCache(cluster); ok {
+		if l != nil {
+			l.Printf("[DEBUG] discover-hcp: using cached addresses for cluster=%s", cluster)
+		}
+		return addrs, nil
+	}
+
+	addrs, err := p.lookup(endpoint, cluster, clientID, clientSecret)
+	if err != nil {
+		return nil, fmt.Errorf("discover-hcp: %w", err)
+	}
+
+	p.storeCache(cluster, addrs)
+	return addrs, nil
+}
+
+func (p *Provider) fromCache(cluster string) ([]string, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.cacheKey != cluster || p.cached == nil {
+		return nil, false
+	}
+	if time.Since(p.cacheAt) > defaultCacheTTL {
+		return nil, false
+	}
+	return p.cached, true
+}
+
+func (p *Provider) storeCache(cluster string, addrs []string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.cacheKey = cluster
+	p.cacheAt = time.Now()
+	p.cached = addrs
+}
+
+func (p *Provider) client() *http.Client {
+	if p.httpClient != nil {
+		return p.httpClient
+	}
+	return &http.Client{Timeout: defaultTimeout}
+}
+
+func (p *Provider) lookup(endpoint, cluster, clientID, clientSecret string) ([]string, error) {
+	reqURL, err := url.Parse(endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse endpoint: %w", err)
+	}
+	q := reqURL.Query()
+	q.Set("cluster", cluster)
+	reqURL.RawQuery = q.Encode()
+
+	req, err := http.NewRequest(http.MethodGet, reqURL.String(), nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build request: %w", err)
+	}
+	if clientID != "" || clientSecret != "" {
+		req.SetBasicAuth(clientID, clientSecret)
+	}
+
+	resp, err := p.client().Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query endpoint: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status code %d from endpoint", resp.StatusCode)
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response body: %w", err)
+	}
+
+	var entries []entry
+	if err := json.Unmarshal(body, &entries); err != nil {
+		return nil, fmt.Errorf("failed to parse response body: %w", err)
+	}
+
+	addrs := make([]string, 0, len(entries))
+	for _, e := range entries {
+		if e.Port != 0 {
+			addrs = append(addrs, fmt.Sprintf("%s:%d", e.Address, e.Port))
+		} else {
+			addrs = append(addrs, e.Address)
+		}
+	}
+
+	return addrs, nil
+}
@@ -0,0 +1,206 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: BUSL-1.1
+
+package discover
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func jsonHandler(t *testing.T, entries []entry, check func(r *http.Request)) http.HandlerFunc {
+	t.Helper()
+	return func(w http.ResponseWriter, r *http.Request) {
+		if check != nil {
+			check(r)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(entries); err != nil {
+			t.Fatalf("failed to encode response: %v", err)
+		}
+	}
+}
+
+func TestProvider_Addrs(t *testing.T) {
+	t.Run("returns ip:port for entries with a port", func(t *testing.T) {
+		srv := httptest.NewServer(jsonHandler(t, []entry{{Address: "10.0.0.1", Port: 4648}}, nil))
+		defer srv.Close()
+
+		p := &Provider{}
+		addrs, err := p.Addrs(map[string]string{"cluster": "prod", "endpoint": srv.URL}, nil)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if len(addrs) != 1 || addrs[0] != "10.0.0.1:4648" {
+			t.Fatalf("unexpected addrs: %v", addrs)
+		}
+	})
+
+	t.Run("returns the bare address when port is unset", func(t *testing.T) {
+		srv := httptest.NewServer(jsonHandler(t, []entry{{Address: "10.0.0.1"}}, nil))
+		defer srv.Close()
+
+		p := &Provider{}
+		addrs, err := p.Addrs(map[string]string{"cluster": "prod", "endpoint": srv.URL}, nil)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if len(addrs) != 1 || addrs[0] != "10.0.0.1" {
+			t.Fatalf("unexpected addrs: %v", addrs)
+		}
+	})
+
+	t.Run("requires cluster", func(t *testing.T) {
+		p := &Provider{}
+		if _, err := p.Addrs(map[string]string{"endpoint": "http://example.com"}, nil); err == nil {
+			t.Fatal("expected an error when cluster is unset")
+		}
+	})
+
+	t.Run("requires endpoint", func(t *testing.T) {
+		p := &Provider{}
+		if _, err := p.Addrs(map[string]string{"cluster": "prod"}, nil); err == nil {
+			t.Fatal("expected an error when endpoint is unset")
+		}
+	})
+
+	t.Run("escapes a cluster value with reserved URL characters", func(t *testing.T) {
+		var gotCluster string
+		srv := httptest.NewServer(jsonHandler(t, []entry{{Address: "10.0.0.1"}}, func(r *http.Request) {
+			gotCluster = r.URL.Query().Get("cluster")
+		}))
+		defer srv.Close()
+
+		p := &Provider{}
+		if _, err := p.Addrs(map[string]string{"cluster": "prod/east us&1", "endpoint": srv.URL}, nil); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if gotCluster != "prod/east us&1" {
+			t.Fatalf("server received mangled cluster value: %q", gotCluster)
+		}
+	})
+
+	t.Run("preserves an existing query string on the endpoint", func(t *testing.T) {
+		var gotFoo, gotCluster string
+		srv := httptest.NewServer(jsonHandler(t, []entry{{Address: "10.0.0.1"}}, func(r *http.Request) {
+			gotFoo = r.URL.Query().Get("foo")
+			gotCluster = r.URL.Query().Get("cluster")
+		}))
+		defer srv.Close()
+
+		p := &Provider{}
+		if _, err := p.Addrs(map[string]string{"cluster": "prod", "endpoint": srv.URL + "?foo=bar"}, nil); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if gotFoo != "bar" {
+			t.Fatalf("expected existing query parameter to survive, got foo=%q", gotFoo)
+		}
+		if gotCluster != "prod" {
+			t.Fatalf("expected cluster query parameter to be set, got %q", gotCluster)
+		}
+	})
+
+	t.Run("sends basic auth when credentials are set", func(t *testing.T) {
+		var gotUser, gotPass string
+		var gotOK bool
+		srv := httptest.NewServer(jsonHandler(t, []entry{{Address: "10.0.0.1"}}, func(r *http.Request) {
+			gotUser, gotPass, gotOK = r.BasicAuth()
+		}))
+		defer srv.Close()
+
+		p := &Provider{}
+		args := map[string]string{
+			"cluster":       "prod",
+			"endpoint":      srv.URL,
+			"client_id":     "my-id",
+			"client_secret": "my-secret",
+		}
+		if _, err := p.Addrs(args, nil); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if !gotOK || gotUser != "my-id" || gotPass != "my-secret" {
+			t.Fatalf("unexpected basic auth: user=%q pass=%q ok=%v", gotUser, gotPass, gotOK)
+		}
+	})
+
+	t.Run("returns an error on a non-200 status", func(t *testing.T) {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusInternalServerError)
+		}))
+		defer srv.Close()
+
+		p := &Provider{}
+		if _, err := p.Addrs(map[string]string{"cluster": "prod", "endpoint": srv.URL}, nil); err == nil {
+			t.Fatal("expected an error on a non-200 response")
+		}
+	})
+
+	t.Run("caches results within the TTL without re-querying the endpoint", func(t *testing.T) {
+		var requests int
+		srv := httptest.NewServer(jsonHandler(t, []entry{{Address: "10.0.0.1"}}, func(r *http.Request) {
+			requests++
+		}))
+		defer srv.Close()
+
+		p := &Provider{}
+		args := map[string]string{"cluster": "prod", "endpoint": srv.URL}
+
+		if _, err := p.Addrs(args, nil); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if _, err := p.Addrs(args, nil); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if requests != 1 {
+			t.Fatalf("expected 1 request with a warm cache, got %d", requests)
+		}
+	})
+
+	t.Run("re-queries the endpoint once the cache entry expires", func(t *testing.T) {
+		var requests int
+		srv := httptest.NewServer(jsonHandler(t, []entry{{Address: "10.0.0.1"}}, func(r *http.Request) {
+			requests++
+		}))
+		defer srv.Close()
+
+		p := &Provider{}
+		args := map[string]string{"cluster": "prod", "endpoint": srv.URL}
+
+		if _, err := p.Addrs(args, nil); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		p.mu.Lock()
+		p.cacheAt = time.Now().Add(-2 * defaultCacheTTL)
+		p.mu.Unlock()
+
+		if _, err := p.Addrs(args, nil); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if requests != 2 {
+			t.Fatalf("expected 2 requests once the cache expired, got %d", requests)
+		}
+	})
+
+	t.Run("cache is keyed per cluster", func(t *testing.T) {
+		var requests int
+		srv := httptest.NewServer(jsonHandler(t, []entry{{Address: "10.0.0.1"}}, func(r *http.Request) {
+			requests++
+		}))
+		defer srv.Close()
+
+		p := &Provider{}
+		if _, err := p.Addrs(map[string]string{"cluster": "prod", "endpoint": srv.URL}, nil); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if _, err := p.Addrs(map[string]string{"cluster": "staging", "endpoint": srv.URL}, nil); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if requests != 2 {
+			t.Fatalf("expected a separate request for a different cluster, got %d requests", requests)
+		}
+	})
+}
@@ -7,12 +7,17 @@ import (
 	"context"
 	"fmt"
 	golog "log"
+	"math/rand"
 	"net"
 	"strings"
+	"sync"
 	"time"
 
+	discover "github.com/hashicorp/go-discover"
+	discoverk8s "github.com/hashicorp/go-discover/provider/k8s"
 	log "github.com/hashicorp/go-hclog"
 	"github.com/hashicorp/go-netaddrs"
+	hcpdiscover "github.com/hashicorp/nomad/command/agent/hcp/discover"
 )
 
 // AutoDiscoverInterface is an interface for autoDiscover to ease testing
@@ -49,6 +54,23 @@ func (n *netAddrs) IPAddrs(ctx context.Context, cfg string, l netaddrs.Logger) (
 	return netaddrs.IPAddrs(ctx, cfg, l)
 }
 
+// newDiscover returns a go-discover Discover instance configured with the
+// default set of providers plus Nomad-specific additions that are not
+// compiled into go-discover by default, such as discoverk8s and the
+// HCP-style hosted discovery provider. It is called once from Agent.Setup
+// and the resulting value is used as the autoDiscover.goDiscover for both
+// server and client retry joiners.
+func newDiscover() (*discover.Discover, error) {
+	providers := make(map[string]discover.Provider, len(discover.Providers)+2)
+	for name, provider := range discover.Providers {
+		providers[name] = provider
+	}
+	providers["k8s"] = &discoverk8s.Provider{}
+	providers["hcp"] = &hcpdiscover.Provider{}
+
+	return discover.New(discover.WithProviders(providers))
+}
+
 // autoDiscover uses go-netaddrs and go-discover to discover IP addresses when
 // auto-joining clusters
 //
@@ -73,7 +95,11 @@ type autoDiscover struct {
 //	             of up to 1024 bytes to stderr.
 //
 // If cfg has a provider= prefix, IP addresses are looked up using the go-discover
-// provider specified in cfg.
+// provider specified in cfg. In addition to the providers built into
+// go-discover, Nomad registers discoverk8s so that `provider=k8s` can be used
+// to resolve server/client addresses from Kubernetes pod IPs (see
+// newDiscover). The supported providers, including k8s, are listed in the
+// output of `nomad agent -help`, which is generated from goDiscover.Help().
 //
 // If cfg contains neither an exec= or provider= prefix, the configuration is
 // returned as-is, to be resolved later via Serf in the server's Join() function,
@@ -116,32 +142,135 @@ type retryJoiner struct {
 
 	// logger is the retry joiners logger
 	logger log.Logger
+
+	// viaGateways is set only on the WAN joiner used for federation, and
+	// only changes RetryJoin's logging. FederationViaGateways lives on the
+	// shared ServerJoin struct, but is a WAN/federation-only concept; the
+	// LAN joiner must not read it off of joinCfg, since the LAN and WAN
+	// joiners share the same underlying ServerJoin value.
+	viaGateways bool
+
+	// backoff tracks the exponential-backoff-with-jitter state across
+	// retry attempts. It is lazily initialized and reset after a
+	// successful join so a later disconnect-driven rejoin starts fast
+	// again.
+	backoff *retryBackoff
+
+	// addrCache remembers the last successfully discovered addresses for
+	// each raw retry_join entry, so later attempts can skip rediscovery
+	// while the cached result is still within its TTL.
+	addrCache *joinAddrCache
+}
+
+// defaultBackoffMultiplier is used when RetryBackoff.Multiplier is unset.
+const defaultBackoffMultiplier = 3.0
+
+// retryBackoff implements AWS's decorrelated-jitter algorithm:
+//
+//	sleep = rand(base, min(cap, prev*multiplier))
+//
+// so that many agents starting at once do not all retry in lockstep.
+type retryBackoff struct {
+	mu   sync.Mutex
+	prev time.Duration
+}
+
+// next returns the duration to sleep before the next retry attempt, given
+// the configured initial interval, cap, and multiplier.
+func (b *retryBackoff) next(initial, max time.Duration, multiplier float64) time.Duration {
+	if initial <= 0 {
+		return 0
+	}
+	if max < initial {
+		max = initial
+	}
+	if multiplier <= 0 {
+		multiplier = defaultBackoffMultiplier
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	prev := b.prev
+	if prev == 0 {
+		prev = initial
+	}
+
+	ceil := time.Duration(float64(prev) * multiplier)
+	if ceil > max {
+		ceil = max
+	}
+	if ceil < initial {
+		ceil = initial
+	}
+
+	sleep := initial + time.Duration(rand.Int63n(int64(ceil-initial)+1))
+	b.prev = sleep
+	return sleep
+}
+
+// reset clears the backoff state so the next call to next() starts from
+// the configured initial interval again.
+func (b *retryBackoff) reset() {
+	b.mu.Lock()
+	b.prev = 0
+	b.mu.Unlock()
+}
+
+// joinAddrCacheEntry is a single cached discovery result.
+type joinAddrCacheEntry struct {
+	addrs      []string
+	discovered time.Time
+}
+
+// joinAddrCache is a small in-memory cache, keyed by the raw retry_join
+// string, of the last successfully discovered addresses. It avoids
+// rediscovering every address on every retry attempt once a provider has
+// already resolved it successfully.
+type joinAddrCache struct {
+	mu      sync.Mutex
+	entries map[string]joinAddrCacheEntry
+}
+
+func newJoinAddrCache() *joinAddrCache {
+	return &joinAddrCache{entries: make(map[string]joinAddrCacheEntry)}
+}
+
+// get returns the cached addresses for key if present and still within ttl.
+func (c *joinAddrCache) get(key string, ttl time.Duration) ([]string, bool) {
+	if ttl <= 0 {
+		return nil, false
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, ok := c.entries[key]
+	if !ok || time.Since(entry.discovered) > ttl {
+		return nil, false
+	}
+	return entry.addrs, true
+}
+
+// put stores addrs as the most recent successful discovery result for key.
+func (c *joinAddrCache) put(key string, addrs []string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries[key] = joinAddrCacheEntry{addrs: addrs, discovered: time.Now()}
 }
 
 // Validate ensures that the configuration passes validity checks for the
-// retry_join block. If the configuration is not valid, returns an error that
+// retry_join block, folding any deprecated join settings into server_join
+// along the way. If the configuration is not valid, returns an error that
 // will be displayed to the operator, otherwise nil.
 func (r *retryJoiner) Validate(config *Config) error {
-	// If retry_join is defined for the server, ensure that deprecated
-	// fields and the server_join block are not both set
-	if config.Server != nil && config.Server.ServerJoin != nil && len(config.Server.ServerJoin.RetryJoin) != 0 {
-		if len(config.Server.RetryJoin) != 0 {
-			return fmt.Errorf("server_join and retry_join cannot both be defined; prefer setting the server_join block")
-		}
-		if len(config.Server.StartJoin) != 0 {
-			return fmt.Errorf("server_join and start_join cannot both be defined; prefer setting the server_join block")
-		}
-		if config.Server.RetryMaxAttempts != 0 {
-			return fmt.Errorf("server_join and retry_max cannot both be defined; prefer setting the server_join block")
-		}
-
-		if config.Server.RetryInterval != 0 {
-			return fmt.Errorf("server_join and retry_interval cannot both be defined; prefer setting the server_join block")
-		}
-
-		if len(config.Server.ServerJoin.StartJoin) != 0 {
-			return fmt.Errorf("retry_join and start_join cannot both be defined")
-		}
+	// -join, -join-wan, start_join, start_join_wan, retry_join, retry_max,
+	// and retry_interval are all deprecated aliases of the server_join
+	// block. Rather than erroring when both are set, fold the deprecated
+	// values into server_join so there is a single retryJoiner code path
+	// to maintain.
+	if config.Server != nil {
+		r.mergeDeprecatedServerJoin(config.Server)
 	}
 
 	// if retry_join is defined for the client, ensure that start_join is not
@@ -152,9 +281,124 @@ func (r *retryJoiner) Validate(config *Config) error {
 		}
 	}
 
+	// federation_via_gateways is a building block for routing WAN federation
+	// joins through mesh gateways, but the Serf transport has no way to dial
+	// a gateway address via TLS-SNI yet, and the primary region does not
+	// publish its server list for secondaries to discover. Until that
+	// transport-side work lands, reject the setting outright rather than
+	// let an operator enable something that silently does not federate.
+	if config.Server != nil && config.Server.ServerJoin != nil && config.Server.ServerJoin.FederationViaGateways {
+		return fmt.Errorf("federation_via_gateways is not yet supported: the Serf transport and primary-region publishing it depends on have not shipped")
+	}
+
 	return nil
 }
 
+// mergeDeprecatedServerJoin folds the deprecated top-level retry_join,
+// start_join, retry_max, retry_interval, start_join_wan, and retry_join_wan
+// server settings into server.ServerJoin, logging a deprecation warning for
+// each one that is set. Values already present on server_join take
+// precedence, so an operator who has migrated part of their config is not
+// silently overridden. This keeps retryJoiner as the single join code path
+// instead of branching on which settings were used.
+func (r *retryJoiner) mergeDeprecatedServerJoin(server *ServerConfig) {
+	if server.ServerJoin == nil {
+		server.ServerJoin = &ServerJoin{}
+	}
+	sj := server.ServerJoin
+
+	if len(sj.StartJoin) != 0 {
+		r.logger.Warn("server_join.start_join is deprecated and will be removed in a future release; use server_join.retry_join instead")
+		if len(sj.RetryJoin) == 0 {
+			sj.RetryJoin = append(sj.RetryJoin, sj.StartJoin...)
+		}
+	}
+	if len(server.StartJoin) != 0 {
+		r.logger.Warn("start_join is deprecated and will be removed in a future release; use server_join.retry_join instead")
+		if len(sj.RetryJoin) == 0 {
+			sj.RetryJoin = append(sj.RetryJoin, server.StartJoin...)
+		}
+	}
+	if len(server.RetryJoin) != 0 {
+		r.logger.Warn("retry_join is deprecated and will be removed in a future release; use server_join.retry_join instead")
+		if len(sj.RetryJoin) == 0 {
+			sj.RetryJoin = server.RetryJoin
+		}
+	}
+	if server.RetryMaxAttempts != 0 {
+		r.logger.Warn("retry_max is deprecated and will be removed in a future release; use server_join.retry_max_attempts instead")
+		if sj.RetryMaxAttempts == 0 {
+			sj.RetryMaxAttempts = server.RetryMaxAttempts
+		}
+	}
+	if server.RetryInterval != 0 {
+		r.logger.Warn("retry_interval is deprecated and will be removed in a future release; use server_join.retry_interval instead")
+		if sj.RetryInterval == 0 {
+			sj.RetryInterval = server.RetryInterval
+		}
+	}
+	if len(server.StartJoinWAN) != 0 {
+		r.logger.Warn("start_join_wan is deprecated and will be removed in a future release; use server_join.retry_join_wan instead")
+		if len(sj.RetryJoinWAN) == 0 {
+			sj.RetryJoinWAN = append(sj.RetryJoinWAN, server.StartJoinWAN...)
+		}
+	}
+	if len(server.RetryJoinWAN) != 0 {
+		r.logger.Warn("retry_join_wan is deprecated and will be removed in a future release; use server_join.retry_join_wan instead")
+		if len(sj.RetryJoinWAN) == 0 {
+			sj.RetryJoinWAN = server.RetryJoinWAN
+		}
+	}
+}
+
+// resolveAddrs discovers the addresses that should be handed to joinFunc for
+// this attempt: the per-entry expansion of joinCfg.RetryJoin via
+// autoDiscover (or the cached result of a prior expansion).
+//
+// For a WAN joiner configured with federation_via_gateways, joinCfg.RetryJoin
+// (copied from RetryJoinWAN) names the primary region's mesh gateways rather
+// than remote servers directly, and RetryJoin() would rely on flood-join to
+// learn the rest of the secondary regions once this join succeeds.
+// Validate() currently rejects federation_via_gateways outright, since
+// dialing the resulting addresses still requires Serf transport support
+// (TLS-SNI routing through the gateway) and primary-region server-list
+// publishing that don't exist in this tree yet; this function is otherwise
+// ready for that mode once those land.
+func (r *retryJoiner) resolveAddrs() []string {
+	var addrs []string
+
+	cacheTTL := r.cacheTTL()
+
+	for _, addr := range r.joinCfg.RetryJoin {
+		servers, cached := r.addrCache.get(addr, cacheTTL)
+		if !cached {
+			// If auto-discovery returns an error, log the error and
+			// fall-through, so we reach the retry logic and loop back around
+			// for another go.
+			discovered, err := r.autoDiscover.Addrs(addr, r.logger)
+			if err != nil {
+				r.logger.Error("discovering join addresses failed", "join_config", addr, "error", err)
+				continue
+			}
+			servers = discovered
+			r.addrCache.put(addr, servers)
+		}
+
+		addrs = append(addrs, servers...)
+	}
+
+	return addrs
+}
+
+// cacheTTL returns the configured TTL for cached discovery results, or zero
+// if retry_backoff (and therefore caching) is not configured.
+func (r *retryJoiner) cacheTTL() time.Duration {
+	if r.joinCfg.RetryBackoff == nil {
+		return 0
+	}
+	return r.joinCfg.RetryBackoff.CacheTTL
+}
+
 // RetryJoin is used to handle retrying a join until it succeeds or all retries
 // are exhausted.
 func (r *retryJoiner) RetryJoin() {
@@ -162,34 +406,33 @@ func (r *retryJoiner) RetryJoin() {
 		return
 	}
 
+	if r.addrCache == nil {
+		r.addrCache = newJoinAddrCache()
+	}
+	if r.backoff == nil {
+		r.backoff = &retryBackoff{}
+	}
+
 	attempt := 0
 
 	addrsToJoin := strings.Join(r.joinCfg.RetryJoin, " ")
-	r.logger.Info("starting retry join", "servers", addrsToJoin)
+	if r.viaGateways {
+		r.logger.Info("starting retry join via mesh gateways", "gateways", addrsToJoin)
+	} else {
+		r.logger.Info("starting retry join", "servers", addrsToJoin)
+	}
 
 	for {
-		var (
-			addrs []string
-			err   error
-		)
+		var err error
+		var numJoined int
 
-		for _, addr := range r.joinCfg.RetryJoin {
-
-			// If auto-discovery returns an error, log the error and
-			// fall-through, so we reach the retry logic and loop back around
-			// for another go.
-			servers, err := r.autoDiscover.Addrs(addr, r.logger)
-			if err != nil {
-				r.logger.Error("discovering join addresses failed", "join_config", addr, "error", err)
-			} else {
-				addrs = append(addrs, servers...)
-			}
-		}
+		addrs := r.resolveAddrs()
 
 		if len(addrs) > 0 && r.joinFunc != nil {
-			numJoined, err := r.joinFunc(addrs)
+			numJoined, err = r.joinFunc(addrs)
 			if err == nil {
 				r.logger.Info("retry join completed", "initial_servers", numJoined)
+				r.backoff.reset()
 				return
 			}
 		}
@@ -204,6 +447,19 @@ func (r *retryJoiner) RetryJoin() {
 		if err != nil {
 			r.logger.Warn("join failed", "error", err, "retry", r.joinCfg.RetryInterval)
 		}
-		time.Sleep(r.joinCfg.RetryInterval)
+		time.Sleep(r.retryWait())
+	}
+}
+
+// retryWait returns how long to sleep before the next retry attempt. When
+// server_join.retry_backoff is configured, it uses exponential backoff with
+// decorrelated jitter; otherwise it falls back to the fixed RetryInterval for
+// backwards compatibility.
+func (r *retryJoiner) retryWait() time.Duration {
+	backoffCfg := r.joinCfg.RetryBackoff
+	if backoffCfg == nil {
+		return r.joinCfg.RetryInterval
 	}
+
+	return r.backoff.next(backoffCfg.InitialInterval, backoffCfg.MaxInterval, backoffCfg.Multiplier)
 }
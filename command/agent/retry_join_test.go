@@ -0,0 +1,415 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: BUSL-1.1
+
+package agent
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	log "github.com/hashicorp/go-hclog"
+)
+
+func TestRetryBackoff_Next(t *testing.T) {
+	ci := []struct {
+		name       string
+		initial    time.Duration
+		max        time.Duration
+		multiplier float64
+		prev       time.Duration
+	}{
+		{
+			name:       "first attempt starts from initial",
+			initial:    1 * time.Second,
+			max:        1 * time.Minute,
+			multiplier: 3,
+			prev:       0,
+		},
+		{
+			name:       "subsequent attempt scales from prev",
+			initial:    1 * time.Second,
+			max:        1 * time.Minute,
+			multiplier: 3,
+			prev:       10 * time.Second,
+		},
+		{
+			name:       "ceiling is clamped to max",
+			initial:    1 * time.Second,
+			max:        5 * time.Second,
+			multiplier: 3,
+			prev:       10 * time.Second,
+		},
+		{
+			name:       "zero multiplier falls back to the default",
+			initial:    1 * time.Second,
+			max:        1 * time.Minute,
+			multiplier: 0,
+			prev:       2 * time.Second,
+		},
+	}
+
+	for _, c := range ci {
+		t.Run(c.name, func(t *testing.T) {
+			b := &retryBackoff{prev: c.prev}
+
+			for i := 0; i < 20; i++ {
+				sleep := b.next(c.initial, c.max, c.multiplier)
+				if sleep < c.initial {
+					t.Fatalf("sleep %s below initial interval %s", sleep, c.initial)
+				}
+				if sleep > c.max {
+					t.Fatalf("sleep %s above max interval %s", sleep, c.max)
+				}
+			}
+		})
+	}
+}
+
+func TestRetryBackoff_NextZeroInitialDisablesBackoff(t *testing.T) {
+	b := &retryBackoff{}
+	if sleep := b.next(0, time.Minute, 3); sleep != 0 {
+		t.Fatalf("expected 0 sleep with a zero initial interval, got %s", sleep)
+	}
+}
+
+func TestRetryBackoff_Reset(t *testing.T) {
+	b := &retryBackoff{prev: 30 * time.Second}
+	b.reset()
+	if b.prev != 0 {
+		t.Fatalf("expected reset to clear prev, got %s", b.prev)
+	}
+}
+
+func TestJoinAddrCache(t *testing.T) {
+	t.Run("miss before any put", func(t *testing.T) {
+		c := newJoinAddrCache()
+		if _, ok := c.get("provider=k8s", time.Minute); ok {
+			t.Fatal("expected miss on empty cache")
+		}
+	})
+
+	t.Run("hit within ttl", func(t *testing.T) {
+		c := newJoinAddrCache()
+		c.put("provider=k8s", []string{"10.0.0.1"})
+
+		addrs, ok := c.get("provider=k8s", time.Minute)
+		if !ok {
+			t.Fatal("expected hit within ttl")
+		}
+		if len(addrs) != 1 || addrs[0] != "10.0.0.1" {
+			t.Fatalf("unexpected cached addrs: %v", addrs)
+		}
+	})
+
+	t.Run("miss once ttl elapses", func(t *testing.T) {
+		c := newJoinAddrCache()
+		c.entries["provider=k8s"] = joinAddrCacheEntry{
+			addrs:      []string{"10.0.0.1"},
+			discovered: time.Now().Add(-2 * time.Minute),
+		}
+
+		if _, ok := c.get("provider=k8s", time.Minute); ok {
+			t.Fatal("expected miss once ttl has elapsed")
+		}
+	})
+
+	t.Run("zero ttl always misses", func(t *testing.T) {
+		c := newJoinAddrCache()
+		c.put("provider=k8s", []string{"10.0.0.1"})
+
+		if _, ok := c.get("provider=k8s", 0); ok {
+			t.Fatal("expected miss with a zero ttl")
+		}
+	})
+
+	t.Run("keys are independent", func(t *testing.T) {
+		c := newJoinAddrCache()
+		c.put("provider=k8s", []string{"10.0.0.1"})
+
+		if _, ok := c.get("provider=hcp", time.Minute); ok {
+			t.Fatal("expected miss for a different key")
+		}
+	})
+}
+
+func TestRetryJoiner_ValidateRejectsFederationViaGateways(t *testing.T) {
+	r := &retryJoiner{logger: log.NewNullLogger()}
+	config := &Config{
+		Server: &ServerConfig{ServerJoin: &ServerJoin{
+			RetryJoinWAN:           []string{"2.2.2.2"},
+			FederationViaGateways: true,
+		}},
+	}
+
+	if err := r.Validate(config); err == nil {
+		t.Fatal("expected federation_via_gateways to be rejected")
+	}
+}
+
+func TestRetryJoiner_ValidateAllowsRetryJoinWANWithoutGateways(t *testing.T) {
+	r := &retryJoiner{logger: log.NewNullLogger()}
+	config := &Config{
+		Server: &ServerConfig{ServerJoin: &ServerJoin{RetryJoinWAN: []string{"2.2.2.2"}}},
+	}
+
+	if err := r.Validate(config); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+// fakeAutoDiscover is a test double for AutoDiscoverInterface that resolves
+// addresses from an in-memory map instead of actually calling out to
+// go-netaddrs or go-discover. Entries in errs fail with the given error.
+type fakeAutoDiscover struct {
+	addrs map[string][]string
+	errs  map[string]error
+	calls int
+}
+
+func (f *fakeAutoDiscover) Addrs(cfg string, _ log.Logger) ([]string, error) {
+	f.calls++
+	if err, ok := f.errs[cfg]; ok {
+		return nil, err
+	}
+	return f.addrs[cfg], nil
+}
+
+func TestRetryJoiner_ResolveAddrs(t *testing.T) {
+	t.Run("discovers and caches addresses per retry_join entry", func(t *testing.T) {
+		fake := &fakeAutoDiscover{addrs: map[string][]string{
+			"provider=k8s": {"10.0.0.1", "10.0.0.2"},
+			"1.1.1.1":      {"1.1.1.1"},
+		}}
+		r := &retryJoiner{
+			autoDiscover: fake,
+			joinCfg:      &ServerJoin{RetryJoin: []string{"provider=k8s", "1.1.1.1"}},
+			logger:       log.NewNullLogger(),
+			addrCache:    newJoinAddrCache(),
+		}
+
+		addrs := r.resolveAddrs()
+		if len(addrs) != 3 {
+			t.Fatalf("expected 3 resolved addrs, got %v", addrs)
+		}
+		if fake.calls != 2 {
+			t.Fatalf("expected one discovery call per retry_join entry, got %d", fake.calls)
+		}
+	})
+
+	t.Run("reuses a cached entry instead of re-discovering", func(t *testing.T) {
+		fake := &fakeAutoDiscover{addrs: map[string][]string{"provider=k8s": {"10.0.0.1"}}}
+		r := &retryJoiner{
+			autoDiscover: fake,
+			joinCfg: &ServerJoin{
+				RetryJoin:    []string{"provider=k8s"},
+				RetryBackoff: &RetryBackoff{CacheTTL: time.Minute},
+			},
+			logger:    log.NewNullLogger(),
+			addrCache: newJoinAddrCache(),
+		}
+
+		r.resolveAddrs()
+		r.resolveAddrs()
+
+		if fake.calls != 1 {
+			t.Fatalf("expected discovery to run once with a warm cache, got %d calls", fake.calls)
+		}
+	})
+
+	t.Run("skips an entry whose discovery fails and continues with the rest", func(t *testing.T) {
+		fake := &fakeAutoDiscover{
+			addrs: map[string][]string{"1.1.1.1": {"1.1.1.1"}},
+			errs:  map[string]error{"provider=broken": fmt.Errorf("provider unavailable")},
+		}
+		r := &retryJoiner{
+			autoDiscover: fake,
+			joinCfg:      &ServerJoin{RetryJoin: []string{"provider=broken", "1.1.1.1"}},
+			logger:       log.NewNullLogger(),
+			addrCache:    newJoinAddrCache(),
+		}
+
+		addrs := r.resolveAddrs()
+		if len(addrs) != 1 || addrs[0] != "1.1.1.1" {
+			t.Fatalf("expected only the successful entry to resolve, got %v", addrs)
+		}
+	})
+}
+
+func TestRetryJoiner_RetryJoinLogsGatewaysOnlyWhenViaGateways(t *testing.T) {
+	ci := []struct {
+		name        string
+		viaGateways bool
+		want        string
+		dontWant    string
+	}{
+		{
+			name:        "LAN joiner logs the plain retry join message",
+			viaGateways: false,
+			want:        "starting retry join",
+			dontWant:    "via mesh gateways",
+		},
+		{
+			name:        "WAN joiner configured for gateways logs the gateway-specific message",
+			viaGateways: true,
+			want:        "starting retry join via mesh gateways",
+		},
+	}
+
+	for _, c := range ci {
+		t.Run(c.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			logger := log.New(&log.LoggerOptions{Output: &buf, Level: log.Info})
+
+			r := &retryJoiner{
+				autoDiscover: &fakeAutoDiscover{},
+				errCh:        make(chan struct{}),
+				joinCfg: &ServerJoin{
+					RetryJoin:        []string{"1.1.1.1"},
+					RetryMaxAttempts: 1,
+					RetryInterval:    time.Millisecond,
+				},
+				joinFunc:    func([]string) (int, error) { return 0, fmt.Errorf("refused") },
+				logger:      logger,
+				viaGateways: c.viaGateways,
+			}
+
+			r.RetryJoin()
+
+			if !strings.Contains(buf.String(), c.want) {
+				t.Fatalf("expected log to contain %q, got: %s", c.want, buf.String())
+			}
+			if c.dontWant != "" && strings.Contains(buf.String(), c.dontWant) {
+				t.Fatalf("expected log not to contain %q, got: %s", c.dontWant, buf.String())
+			}
+		})
+	}
+}
+
+func TestRetryJoiner_RetryJoinLogsJoinFailure(t *testing.T) {
+	var buf bytes.Buffer
+	logger := log.New(&log.LoggerOptions{Output: &buf, Level: log.Warn})
+
+	r := &retryJoiner{
+		autoDiscover: &fakeAutoDiscover{addrs: map[string][]string{"1.1.1.1": {"1.1.1.1"}}},
+		errCh:        make(chan struct{}),
+		joinCfg: &ServerJoin{
+			RetryJoin:        []string{"1.1.1.1"},
+			RetryMaxAttempts: 1,
+			RetryInterval:    time.Millisecond,
+		},
+		joinFunc: func([]string) (int, error) { return 0, fmt.Errorf("dial tcp: connection refused") },
+		logger:   logger,
+	}
+
+	r.RetryJoin()
+
+	if !strings.Contains(buf.String(), "join failed") {
+		t.Fatalf("expected a logged join failure, got: %s", buf.String())
+	}
+	if !strings.Contains(buf.String(), "connection refused") {
+		t.Fatalf("expected the join error to be included in the log line, got: %s", buf.String())
+	}
+}
+
+func TestRetryJoiner_MergeDeprecatedServerJoin(t *testing.T) {
+	ci := []struct {
+		name     string
+		server   *ServerConfig
+		expected *ServerJoin
+	}{
+		{
+			name: "deprecated retry_join is folded in when server_join is unset",
+			server: &ServerConfig{
+				RetryJoin: []string{"1.1.1.1"},
+			},
+			expected: &ServerJoin{RetryJoin: []string{"1.1.1.1"}},
+		},
+		{
+			name: "deprecated start_join is folded in when server_join is unset",
+			server: &ServerConfig{
+				StartJoin: []string{"1.1.1.1"},
+			},
+			expected: &ServerJoin{RetryJoin: []string{"1.1.1.1"}},
+		},
+		{
+			name: "server_join takes precedence over deprecated retry_join",
+			server: &ServerConfig{
+				RetryJoin:  []string{"1.1.1.1"},
+				ServerJoin: &ServerJoin{RetryJoin: []string{"2.2.2.2"}},
+			},
+			expected: &ServerJoin{RetryJoin: []string{"2.2.2.2"}},
+		},
+		{
+			name: "deprecated retry_max and retry_interval are folded in",
+			server: &ServerConfig{
+				RetryMaxAttempts: 5,
+				RetryInterval:    10 * time.Second,
+			},
+			expected: &ServerJoin{RetryMaxAttempts: 5, RetryInterval: 10 * time.Second},
+		},
+		{
+			name: "server_join retry_max takes precedence",
+			server: &ServerConfig{
+				RetryMaxAttempts: 5,
+				ServerJoin:       &ServerJoin{RetryMaxAttempts: 9},
+			},
+			expected: &ServerJoin{RetryMaxAttempts: 9},
+		},
+		{
+			name: "deprecated start_join_wan is folded into retry_join_wan",
+			server: &ServerConfig{
+				StartJoinWAN: []string{"3.3.3.3"},
+			},
+			expected: &ServerJoin{RetryJoinWAN: []string{"3.3.3.3"}},
+		},
+		{
+			name: "deprecated retry_join_wan is folded in",
+			server: &ServerConfig{
+				RetryJoinWAN: []string{"3.3.3.3"},
+			},
+			expected: &ServerJoin{RetryJoinWAN: []string{"3.3.3.3"}},
+		},
+		{
+			name: "server_join retry_join_wan takes precedence",
+			server: &ServerConfig{
+				RetryJoinWAN: []string{"3.3.3.3"},
+				ServerJoin:   &ServerJoin{RetryJoinWAN: []string{"4.4.4.4"}},
+			},
+			expected: &ServerJoin{RetryJoinWAN: []string{"4.4.4.4"}},
+		},
+	}
+
+	for _, c := range ci {
+		t.Run(c.name, func(t *testing.T) {
+			r := &retryJoiner{logger: log.NewNullLogger()}
+			r.mergeDeprecatedServerJoin(c.server)
+
+			got := c.server.ServerJoin
+			if len(got.RetryJoin) != len(c.expected.RetryJoin) {
+				t.Fatalf("RetryJoin = %v, want %v", got.RetryJoin, c.expected.RetryJoin)
+			}
+			for i := range got.RetryJoin {
+				if got.RetryJoin[i] != c.expected.RetryJoin[i] {
+					t.Fatalf("RetryJoin = %v, want %v", got.RetryJoin, c.expected.RetryJoin)
+				}
+			}
+			if got.RetryMaxAttempts != c.expected.RetryMaxAttempts {
+				t.Fatalf("RetryMaxAttempts = %d, want %d", got.RetryMaxAttempts, c.expected.RetryMaxAttempts)
+			}
+			if got.RetryInterval != c.expected.RetryInterval {
+				t.Fatalf("RetryInterval = %s, want %s", got.RetryInterval, c.expected.RetryInterval)
+			}
+			if len(got.RetryJoinWAN) != len(c.expected.RetryJoinWAN) {
+				t.Fatalf("RetryJoinWAN = %v, want %v", got.RetryJoinWAN, c.expected.RetryJoinWAN)
+			}
+			for i := range got.RetryJoinWAN {
+				if got.RetryJoinWAN[i] != c.expected.RetryJoinWAN[i] {
+					t.Fatalf("RetryJoinWAN = %v, want %v", got.RetryJoinWAN, c.expected.RetryJoinWAN)
+				}
+			}
+		})
+	}
+}